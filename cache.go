@@ -0,0 +1,116 @@
+package tmpl
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Record is a single row as produced by the Sql family of FuncMap
+// functions.
+type Record = []interface{}
+
+// Cache is the result cache used by SqlCached. Implementations must be
+// safe for concurrent use. Rows returned by Get must not be mutated by the
+// caller.
+type Cache interface {
+	Get(key string) ([]Record, bool)
+	Set(key string, rows []Record, ttl time.Duration)
+}
+
+// noCacheMarker is a sentinel value that, when passed as one of the args to
+// a function returned by SqlCached, makes that one call bypass the cache.
+type noCacheMarker struct{}
+
+// NoCache is installed in a template.FuncMap as "nocache". Pass its result
+// as one of the arguments to a function returned by SqlCached to bypass the
+// cache for that single call, e.g.:
+//
+//	{{range sql "select ... from fast_changing_table" (nocache)}} ... {{end}}
+func NoCache() interface{} { return noCacheMarker{} }
+
+// SqlCached wraps db with cache in front of it: queries made with the same
+// query string and args within ttl of each other are served from cache
+// instead of hitting the database, which is useful for dashboard-style
+// pages where the underlying data changes far less often than the page is
+// requested.
+//
+// SqlCached has the same signature as Sql, so it is a drop-in replacement
+// in a template.FuncMap: a cache hit is replayed onto a fresh channel
+// exactly like a live query would be, so existing templates don't change.
+//
+// Entries are keyed on query + fmt.Sprintf("%v", args).
+func SqlCached(db *sql.DB, cache Cache, ttl time.Duration) func(query string, args ...interface{}) (<-chan []interface{}, error) {
+	h := &dbhandler{db: db, stmt: make(map[string]*sql.Stmt)}
+	return (&cachedSql{h: h, cache: cache, ttl: ttl}).sql
+}
+
+type cachedSql struct {
+	h     *dbhandler
+	cache Cache
+	ttl   time.Duration
+}
+
+func (c *cachedSql) sql(query string, args ...interface{}) (<-chan []interface{}, error) {
+	args, bypass := stripNoCache(args)
+	if bypass {
+		return c.h.sqls(query, args...)
+	}
+
+	key := query + fmt.Sprintf("%v", args)
+	if rows, ok := c.cache.Get(key); ok {
+		return replay(rows), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, ch, errc, err := c.h.sql(ctx.Done(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]Record, 0)
+	for rec := range ch {
+		rows = append(rows, rec)
+	}
+	if err := <-errc; err != nil {
+		// The query was cut short (a scan error, a rows.Close error, or our
+		// own timeout firing): rows holds a partial result, not one fit to
+		// serve for the next ttl. Skip caching it, but still answer this
+		// request with what came back, exactly like an uncached query would.
+		log.Printf("tmpl: SqlCached: not caching %q, query did not complete: %v", key, err)
+		return replay(rows), nil
+	}
+	c.cache.Set(key, rows, c.ttl)
+	return replay(rows), nil
+}
+
+// stripNoCache removes any noCacheMarker found in args, reporting whether
+// one was present.
+func stripNoCache(args []interface{}) ([]interface{}, bool) {
+	out := make([]interface{}, 0, len(args))
+	bypass := false
+	for _, a := range args {
+		if _, ok := a.(noCacheMarker); ok {
+			bypass = true
+			continue
+		}
+		out = append(out, a)
+	}
+	return out, bypass
+}
+
+// replay serves rows over a freshly made channel, exactly like a live
+// dbhandler query would.
+func replay(rows []Record) <-chan []interface{} {
+	ch := make(chan []interface{})
+	go func() {
+		defer close(ch)
+		for _, r := range rows {
+			ch <- r
+		}
+	}()
+	return ch
+}
@@ -1,6 +1,7 @@
 package tmpl
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"sync"
@@ -19,6 +20,24 @@ func SqlDebug(db *sql.DB) func(query string, args ...interface{}) (<-chan []inte
 	return (&dbhandler{db: db, debug: true, stmt: make(map[string]*sql.Stmt)}).sqls
 }
 
+// SqlCtx is like Sql, but the returned function takes an explicit
+// context.Context as its first argument instead of using a fixed one-minute
+// send timeout: once ctx is done, the query's goroutine aborts instead of
+// leaking until a hardcoded timeout fires. Register it in a template.FuncMap
+// alongside the builtin "context" function (which the handler binds to the
+// current request's context) so that closing the client
+// connection cancels any query still in flight, e.g.
+//
+//	{{range $r := sqlctx context "select ... from big_table"}} ... {{end}}
+func SqlCtx(db *sql.DB) func(ctx context.Context, query string, args ...interface{}) (<-chan []interface{}, error) {
+	return (&dbhandler{db: db, stmt: make(map[string]*sql.Stmt)}).sqlsCtx
+}
+
+// SqlCtxDebug is identical to SqlCtx but will log query debug information on stderr.
+func SqlCtxDebug(db *sql.DB) func(ctx context.Context, query string, args ...interface{}) (<-chan []interface{}, error) {
+	return (&dbhandler{db: db, debug: true, stmt: make(map[string]*sql.Stmt)}).sqlsCtx
+}
+
 type ResultSet struct {
 	Columns []string
 	Records <-chan []interface{}
@@ -50,6 +69,16 @@ func SqlRDebug(db *sql.DB) func(query string, args ...interface{}) (*ResultSet,
 	return (&dbhandler{db: db, debug: true, stmt: make(map[string]*sql.Stmt)}).sqlr
 }
 
+// SqlRCtx wraps SqlCtx so it returns a ResultSet instead of a channel of slices.
+func SqlRCtx(db *sql.DB) func(ctx context.Context, query string, args ...interface{}) (*ResultSet, error) {
+	return (&dbhandler{db: db, stmt: make(map[string]*sql.Stmt)}).sqlrCtx
+}
+
+// SqlRCtxDebug is identical to SqlRCtx but will log query debug information on stderr.
+func SqlRCtxDebug(db *sql.DB) func(ctx context.Context, query string, args ...interface{}) (*ResultSet, error) {
+	return (&dbhandler{db: db, debug: true, stmt: make(map[string]*sql.Stmt)}).sqlrCtx
+}
+
 type dbhandler struct {
 	db    *sql.DB
 	debug bool
@@ -74,41 +103,75 @@ func (h *dbhandler) prep(query string) (*sql.Stmt, error) {
 }
 
 func (h *dbhandler) sqls(query string, args ...interface{}) (<-chan []interface{}, error) {
-	_, ch, err := h.sql(query, args...)
-	return ch, err
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	_, ch, errc, err := h.sql(ctx.Done(), query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() { <-errc; cancel() }()
+	return ch, nil
 }
 
 func (h *dbhandler) sqlr(query string, args ...interface{}) (*ResultSet, error) {
-	cols, ch, err := h.sql(query, args...)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	cols, ch, errc, err := h.sql(ctx.Done(), query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() { <-errc; cancel() }()
+	return &ResultSet{cols, ch}, nil
+}
+
+func (h *dbhandler) sqlsCtx(ctx context.Context, query string, args ...interface{}) (<-chan []interface{}, error) {
+	_, ch, _, err := h.sql(ctx.Done(), query, args...)
+	return ch, err
+}
+
+func (h *dbhandler) sqlrCtx(ctx context.Context, query string, args ...interface{}) (*ResultSet, error) {
+	cols, ch, _, err := h.sql(ctx.Done(), query, args...)
 	if err != nil {
 		return nil, err
 	}
 	return &ResultSet{cols, ch}, err
 }
 
-func (h *dbhandler) sql(query string, args ...interface{}) ([]string, <-chan []interface{}, error) {
+// sql runs query and streams the results over the returned channel. Cancel
+// is checked on every send to the channel: once it fires, the goroutine
+// abandons the query instead of leaking until the calling template finishes
+// iterating (or forever, if it never does). sqls/sqlr pass a fixed
+// one-minute timeout for backwards compatibility; sqlsCtx/sqlrCtx pass
+// ctx.Done() so a request's own cancellation controls the timeout.
+//
+// The returned errc receives exactly one value, just before ch is closed:
+// nil if every row was scanned and sent, or the error (a scan error, a
+// rows.Close error, or context.Canceled if cancel fired early) that cut the
+// result set short. Callers that only range over ch, like a template's
+// {{range}}, can ignore errc; SqlCached uses it to avoid caching a
+// truncated result as if it were complete.
+func (h *dbhandler) sql(cancel <-chan struct{}, query string, args ...interface{}) ([]string, <-chan []interface{}, <-chan error, error) {
 	stmt, err := h.prep(query)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	rows, err := stmt.Query(args...)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	retn, err := rows.Columns()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	ch := make(chan []interface{})
+	errc := make(chan error, 1)
 	go func() {
 		if h.debug {
 			defer func(start time.Time) { log.Printf("%v %q", time.Now().Sub(start), query) }(time.Now())
 		}
 		defer close(ch)
-		// this would leak a goroutine if the calling template does not
-		// complete the iteration over the returned channel, so we guard with a timeout.
-		to := time.After(time.Minute)
+		var scanErr error
 	L:
 		for rows.Next() {
 			retv := make([]interface{}, len(retn))
@@ -118,6 +181,7 @@ func (h *dbhandler) sql(query string, args ...interface{}) ([]string, <-chan []i
 			}
 			if err := rows.Scan(retvv...); err != nil {
 				log.Printf("Error on scan: %v Query: %q", err, query)
+				scanErr = err
 				break
 			}
 
@@ -130,15 +194,20 @@ func (h *dbhandler) sql(query string, args ...interface{}) ([]string, <-chan []i
 			select {
 			case ch <- retv:
 				// nix
-			case <-to:
-				log.Printf("Query timed out: %q", query)
+			case <-cancel:
+				log.Printf("Query canceled: %q", query)
+				scanErr = context.Canceled
 				break L
 			}
 		}
 		if err := rows.Close(); err != nil {
 			log.Printf("Error on close: %v Query: %q", err, query)
+			if scanErr == nil {
+				scanErr = err
+			}
 		}
+		errc <- scanErr
 	}()
 
-	return retn, ch, nil
+	return retn, ch, errc, nil
 }
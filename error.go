@@ -0,0 +1,118 @@
+package tmpl
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ErrorData is passed as the argument to a convention-based error template
+// (see ErrorHandler). Err is only populated when the handler rendering the
+// page was constructed with WithErrorDetails; otherwise it is the empty
+// string, so a template that unconditionally prints {{.Err}} is safe by
+// default.
+type ErrorData struct {
+	Status     int
+	StatusText string
+	Path       string
+	Err        string
+}
+
+// errorTemplateNames returns the candidate error template names for status,
+// most specific first: the exact status code (e.g. "404"), then its class
+// (e.g. "4xx").
+func errorTemplateNames(status int) []string {
+	return []string{strconv.Itoa(status), fmt.Sprintf("%dxx", status/100)}
+}
+
+// templateSource is implemented by the handlers returned by NewHandler and
+// NewWatchedHandler; it lets ErrorHandler reach their current template set
+// and error-detail setting without exporting the handler type itself.
+type templateSource interface {
+	template() *template.Template
+	exposeErrors() bool
+}
+
+func (th *handler) template() *template.Template {
+	th.Lock()
+	defer th.Unlock()
+	return th.tmpl
+}
+
+func (th *handler) exposeErrors() bool { return th.exposeErrorDetails }
+
+// renderError writes an error response for status, rendering the template
+// named by convention after the status ("404", then "4xx") found in t if
+// there is one, and falling back to http.Error otherwise. Err is only
+// included in the data passed to the template when exposeErr is true.
+func renderError(t *template.Template, exposeErr bool, w http.ResponseWriter, r *http.Request, status int, err error) {
+	var et *template.Template
+	if t != nil {
+		for _, name := range errorTemplateNames(status) {
+			if et = t.Lookup(name); et != nil {
+				break
+			}
+		}
+	}
+	if et != nil {
+		// Execute a clone: once a template of the shared set has executed,
+		// html/template refuses to Clone that set, which serve does on
+		// every request.
+		c, cloneErr := et.Clone()
+		if cloneErr != nil {
+			log.Printf("Cloning error template %q: %v", et.Name(), cloneErr)
+		}
+		et = c
+	}
+	if et == nil {
+		msg := http.StatusText(status)
+		if exposeErr && err != nil {
+			msg = err.Error()
+		}
+		http.Error(w, msg, status)
+		return
+	}
+
+	data := ErrorData{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Path:       r.URL.Path,
+	}
+	if exposeErr && err != nil {
+		data.Err = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if execErr := et.Execute(w, data); execErr != nil {
+		log.Printf("Executing error template %q: %v", et.Name(), execErr)
+	}
+}
+
+// renderError is the handler's own entry point into renderError, used by
+// ServeHTTP and serve.
+func (th *handler) renderError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	renderError(th.template(), th.exposeErrors(), w, r, status, err)
+}
+
+// ErrorHandler renders status as an error page using th's currently
+// compiled templates, following the same convention as ServeHTTP: a
+// template named after the exact status (e.g. "404"), else one named after
+// its class (e.g. "4xx", "5xx"), falling back to a plain http.Error if
+// neither is defined. Th must be a handler returned by NewHandler or
+// NewWatchedHandler.
+//
+// This lets code outside this package — most commonly auth middleware
+// sitting in front of a tmpl handler — render 401/403 pages with the same
+// look and feel as the rest of the site. Err is only included in the
+// rendered page if th was constructed with WithErrorDetails.
+func ErrorHandler(th http.Handler, w http.ResponseWriter, r *http.Request, status int, err error) {
+	src, ok := th.(templateSource)
+	if !ok {
+		renderError(nil, false, w, r, status, err)
+		return
+	}
+	renderError(src.template(), src.exposeErrors(), w, r, status, err)
+}
@@ -25,6 +25,21 @@ type catchWrites struct {
 
 func (w catchWrites) Write(b []byte) (int, error) { return w.Writer.Write(b) }
 
+// Flush makes catchWrites satisfy http.Flusher. Without this, a Flush call
+// on a gzip-wrapped ResponseWriter (e.g. from tmpl's own {{flush}} or
+// WithFlushInterval) would flush the underlying connection while the
+// compressed bytes are still sitting unwritten in the gzip.Writer's
+// internal buffer, defeating the point of flushing. Flush the gzip.Writer
+// first so it emits what it has, then flush the connection underneath it.
+func (w catchWrites) Flush() {
+	if gz, ok := w.Writer.(*gzip.Writer); ok {
+		gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 // Gzip wraps a handler such that the response will be gzipped if the request specifies gzip
 // as an acceptable encoding.  It is not specific to this packages but useful to have around.
 func Gzip(handler http.Handler) http.Handler {
@@ -0,0 +1,106 @@
+package tmpl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUGetSetRoundtrip(t *testing.T) {
+	c := NewLRU(10)
+	rows := []Record{{"a", 1}, {"b", 2}}
+	c.Set("k", rows, time.Minute)
+
+	got, ok := c.Get("k")
+	if !ok {
+		t.Fatal("expected k to be present")
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("got %d rows, want %d", len(got), len(rows))
+	}
+}
+
+func TestLRUMissingKey(t *testing.T) {
+	c := NewLRU(10)
+	if _, ok := c.Get("nope"); ok {
+		t.Fatal("expected Get on an empty cache to report absent")
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU(2)
+	c.Set("a", []Record{{"a"}}, time.Minute)
+	c.Set("b", []Record{{"b"}}, time.Minute)
+
+	// Touch "a" so "b" becomes the least recently used entry.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be present")
+	}
+
+	c.Set("c", []Record{{"c"}}, time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("expected b to have been evicted as least recently used")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to still be present")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Fatal("expected c to be present")
+	}
+}
+
+func TestLRURespectsCapacityAcrossManyInserts(t *testing.T) {
+	c := NewLRU(3)
+	for i := 0; i < 10; i++ {
+		c.Set(string(rune('a'+i)), []Record{{i}}, time.Minute)
+	}
+	count := 0
+	for i := 0; i < 10; i++ {
+		if _, ok := c.Get(string(rune('a' + i))); ok {
+			count++
+		}
+	}
+	if count != 3 {
+		t.Fatalf("expected exactly 3 entries to survive a capacity of 3, got %d", count)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := NewLRU(10)
+	c.Set("k", []Record{{"v"}}, time.Millisecond)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("expected an entry past its ttl to be reported as absent")
+	}
+	// A lookup of an expired entry should also remove it from the LRU's
+	// internal bookkeeping rather than leaving it to rot.
+	c.mu.Lock()
+	_, stillTracked := c.items["k"]
+	c.mu.Unlock()
+	if stillTracked {
+		t.Fatal("expected expired entry to be removed from internal bookkeeping")
+	}
+}
+
+func TestLRUSetRefreshesExistingEntry(t *testing.T) {
+	c := NewLRU(10)
+	c.Set("k", []Record{{"v1"}}, time.Minute)
+	c.Set("k", []Record{{"v2"}}, time.Minute)
+
+	got, ok := c.Get("k")
+	if !ok {
+		t.Fatal("expected k to be present")
+	}
+	if got[0][0] != "v2" {
+		t.Fatalf("got %v, want updated value v2", got[0][0])
+	}
+
+	c.mu.Lock()
+	n := c.ll.Len()
+	c.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected re-Set of an existing key not to grow the list, len = %d", n)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build redis
+
+package tmpl
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	// The concrete types database/sql.Rows.Scan can produce into an
+	// interface{} (see dbhandler.sql in db.go, which additionally turns
+	// []byte into string). gob needs every concrete type that crosses an
+	// interface{} boundary registered, or encoding fails with an error.
+	gob.Register(string(""))
+	gob.Register(int64(0))
+	gob.Register(float64(0))
+	gob.Register(bool(false))
+	gob.Register(time.Time{})
+	gob.Register([]byte(nil))
+}
+
+// RedisCache is a Cache implementation backed by Redis, for sharing cached
+// query results across multiple instances of a server instead of keeping a
+// separate LRU per process. Only built when the "redis" build tag is set,
+// so programs that don't need it aren't forced to depend on a redis
+// client.
+//
+// Unlike LRU, which keeps the original []Record values in memory, RedisCache
+// round-trips rows through encoding/gob to cross the network. Gob preserves
+// concrete Go types (int64 stays int64, time.Time stays time.Time) the way
+// encoding/json does not, but every concrete type a scanned column can hold
+// must be registered with gob.Register before use — this file registers the
+// ones dbhandler.sql itself produces (string, int64, float64, bool,
+// time.Time, []byte). If a driver or a custom ArgGetter/query path can hand
+// back some other concrete type, register it too, or Set will fail (and log
+// and skip caching that entry rather than silently corrupting it).
+type RedisCache struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedisCache returns a Cache that stores entries in rdb under keys
+// prefixed with prefix.
+func NewRedisCache(rdb *redis.Client, prefix string) *RedisCache {
+	return &RedisCache{rdb: rdb, prefix: prefix}
+}
+
+func (c *RedisCache) Get(key string) ([]Record, bool) {
+	b, err := c.rdb.Get(context.Background(), c.prefix+key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var rows []Record
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&rows); err != nil {
+		log.Printf("tmpl: RedisCache: decoding %q: %v", key, err)
+		return nil, false
+	}
+	return rows, true
+}
+
+func (c *RedisCache) Set(key string, rows []Record, ttl time.Duration) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rows); err != nil {
+		log.Printf("tmpl: RedisCache: not caching %q, encoding failed: %v", key, err)
+		return
+	}
+	c.rdb.Set(context.Background(), c.prefix+key, buf.Bytes(), ttl)
+}
@@ -0,0 +1,99 @@
+package tmpl
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/schema"
+)
+
+// WithSchema associates name, a template name as looked up by ServeHTTP,
+// with a struct type describing that template's arguments, on the handler
+// being constructed. When a request is served for that template, instead
+// of the stringly-typed map[string]interface{} built by GetArgs, a new
+// value of this type is decoded from the request and passed as the
+// template's argument:
+//
+//   - if the request is a POST or PUT with an application/json body, its
+//     fields are decoded by their `json` tag;
+//   - then request form values (GET and POST) are decoded by their `form`
+//     tag, using github.com/gorilla/schema;
+//   - then gorilla mux.Vars are decoded by their `mux` tag, the same way.
+//
+// As with GetArgs, later sources overwrite fields set by earlier ones.
+// Templates with no schema registered on the handler keep using GetArgs (or
+// whatever ArgGetter the handler was constructed with).
+//
+// The schema is scoped to this one handler (not shared package-wide), so
+// two handlers can each have a differently-shaped "index.html" without
+// clobbering each other:
+//
+//	type ReportArgs struct {
+//		Page int `form:"page" json:"page"`
+//		ID   int `mux:"id" json:"id"`
+//	}
+//	tmpl.NewHandler(glob, nil, fm, tmpl.WithSchema("report.html", reflect.TypeOf(ReportArgs{})))
+func WithSchema(name string, t reflect.Type) Option {
+	return func(th *handler) {
+		if th.schemas == nil {
+			th.schemas = make(map[string]reflect.Type)
+		}
+		th.schemas[name] = t
+	}
+}
+
+var (
+	formSchemaDecoder = newSchemaDecoder("form")
+	muxSchemaDecoder  = newSchemaDecoder("mux")
+)
+
+func newSchemaDecoder(tag string) *schema.Decoder {
+	d := schema.NewDecoder()
+	d.IgnoreUnknownKeys(true)
+	d.SetAliasTag(tag)
+	return d
+}
+
+// decodeSchema decodes r into a new value of t, as described by WithSchema,
+// and returns it (not a pointer) for use as a template argument.
+func decodeSchema(r *http.Request, t reflect.Type) (interface{}, error) {
+	v := reflect.New(t)
+	ptr := v.Interface()
+
+	if r.Method == "POST" || r.Method == "PUT" {
+		ct := r.Header.Get("Content-Type")
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		ct, _, _ = mime.ParseMediaType(ct)
+		if ct == "application/json" {
+			defer r.Body.Close()
+			if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(ptr); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	if err := formSchemaDecoder.Decode(ptr, r.Form); err != nil {
+		return nil, err
+	}
+
+	if vars := mux.Vars(r); len(vars) > 0 {
+		muxValues := make(map[string][]string, len(vars))
+		for k, v := range vars {
+			muxValues[k] = []string{v}
+		}
+		if err := muxSchemaDecoder.Decode(ptr, muxValues); err != nil {
+			return nil, err
+		}
+	}
+
+	return v.Elem().Interface(), nil
+}
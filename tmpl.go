@@ -1,6 +1,8 @@
 package tmpl
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"html/template"
 	"io"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 
@@ -24,12 +27,63 @@ type handler struct {
 	getArgs ArgGetter
 	fm      template.FuncMap
 
+	streamingThreshold int
+	exposeErrorDetails bool
+	flushInterval      time.Duration
+	schemas            map[string]reflect.Type
+
 	sync.Mutex
 	lastParsed time.Time
 	tmpl       *template.Template
 	err        error
 }
 
+// Option configures optional behaviour of a handler constructed by
+// NewHandler or NewWatchedHandler.
+type Option func(*handler)
+
+// WithStreamingThreshold makes the handler fall back to streaming the
+// response directly to the client once the rendered output exceeds n bytes,
+// instead of buffering the whole response in memory. Without this option
+// (or with n <= 0) the handler always buffers the full response, so that a
+// failed render never reaches the client as a broken, truncated 200; set
+// this for templates that can legitimately produce very large output (e.g.
+// driven by a {{sql}} query over many rows) where buffering everything
+// would be wasteful.
+func WithStreamingThreshold(n int) Option {
+	return func(th *handler) { th.streamingThreshold = n }
+}
+
+// WithErrorDetails makes error pages include the underlying error message
+// (e.g. from a failed ArgGetter, or a template execution error) in the Err
+// field passed to an error template. Off by default: an ArgGetter or a
+// template can easily end up handling sensitive state, and echoing
+// err.Error() straight to the client is an easy way to leak it.
+func WithErrorDetails() Option {
+	return func(th *handler) { th.exposeErrorDetails = true }
+}
+
+// WithFlushInterval makes the handler periodically flush the response to
+// the client (via http.Flusher) while a template is executing, roughly
+// every d, instead of buffering it all up and writing it in one go. It is
+// meant for templates driven by a long-running {{sql}} query, so the
+// client starts seeing rows as they come in rather than waiting for the
+// whole result set. Combine with the {{flush}} template function to force a
+// flush at a specific point, e.g. at the end of each {{range}} iteration.
+func WithFlushInterval(d time.Duration) Option {
+	return func(th *handler) { th.flushInterval = d }
+}
+
+// builtinFuncs are placeholders for the functions that are re-bound to the
+// current request by serve (via Template.Clone + Funcs) before execution:
+// they must be present under these names at parse time for templates that
+// use them to parse at all, but are never actually called through these
+// definitions.
+var builtinFuncs = template.FuncMap{
+	"flush":   func() string { return "" },
+	"context": func() context.Context { return context.Background() },
+}
+
 func (th *handler) recompileIfOlderThan(t time.Time) {
 	th.Lock()
 	defer th.Unlock()
@@ -37,7 +91,14 @@ func (th *handler) recompileIfOlderThan(t time.Time) {
 		return
 	}
 	th.lastParsed = time.Now()
-	th.tmpl, th.err = template.New("/").Funcs(th.fm).ParseGlob(th.pattern)
+	fm := make(template.FuncMap, len(builtinFuncs)+len(th.fm))
+	for k, v := range builtinFuncs {
+		fm[k] = v
+	}
+	for k, v := range th.fm {
+		fm[k] = v
+	}
+	th.tmpl, th.err = template.New("/").Funcs(fm).ParseGlob(th.pattern)
 	if th.err != nil {
 		log.Printf("Compiling templates %q: %v", th.pattern, th.err)
 	} else {
@@ -57,12 +118,14 @@ func names(t *template.Template) []string {
 //
 // Ag must be a function that returns the argument object to template.Execute given a request,
 // when nil, the handler will use the GetArgs function from this package.
-// Beware that an error returned by ag will be rendered in the 400 response,
-// so be sure not to leak sensitive state.
+// An error returned by ag is rendered as a 400 response; the error's
+// message is suppressed unless the handler is constructed with
+// WithErrorDetails, so it is safe for ag to fail with an error that carries
+// sensitive state.
 //
 // Fm may contain extra functions for use in the templates.
 // See https://golang.org/pkg/text/template/#Template.Funcs for more details.
-func NewHandler(glob string, ag ArgGetter, fm template.FuncMap) http.Handler {
+func NewHandler(glob string, ag ArgGetter, fm template.FuncMap, opts ...Option) http.Handler {
 	if ag == nil {
 		ag = GetArgs
 	}
@@ -71,6 +134,9 @@ func NewHandler(glob string, ag ArgGetter, fm template.FuncMap) http.Handler {
 		getArgs: ag,
 		fm:      fm,
 	}
+	for _, opt := range opts {
+		opt(th)
+	}
 	th.recompileIfOlderThan(time.Time{})
 	return th
 }
@@ -164,12 +230,20 @@ func (th *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	lastMod, err := lastModified(th.pattern)
 	if err != nil {
 		log.Println("Stat templates: ", err)
-		http.Error(w, "Missing templates?", http.StatusInternalServerError)
+		th.renderError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	th.recompileIfOlderThan(lastMod)
+	th.serve(w, r)
+}
+
+// serve renders the request assuming th.tmpl is already up to date; it does
+// not touch the filesystem. Callers are responsible for triggering a
+// recompile (by stat-ing the glob, or in response to a filesystem event)
+// before calling serve.
+func (th *handler) serve(w http.ResponseWriter, r *http.Request) {
 	if th.err != nil || th.tmpl == nil {
-		http.Error(w, "Miscompiled templates.", http.StatusInternalServerError)
+		th.renderError(w, r, http.StatusInternalServerError, th.err)
 		return
 	}
 
@@ -181,7 +255,7 @@ func (th *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	t := th.tmpl.Lookup(name)
 	if t == nil {
 		if name != "index" {
-			http.NotFound(w, r)
+			th.renderError(w, r, http.StatusNotFound, nil)
 			return
 		}
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -191,31 +265,129 @@ func (th *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	args, err := th.getArgs(r)
+	var args interface{}
+	var err error
+	if st, ok := th.schemas[name]; ok {
+		args, err = decodeSchema(r, st)
+	} else {
+		args, err = th.getArgs(r)
+	}
+	if err != nil {
+		th.renderError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// Clone the template set so the "flush" and "context" funcs below can
+	// close over this request's bufferedWriter and context without racing
+	// with other requests executing the same (shared) *handler.tmpl.
+	t, err = t.Clone()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("Cloning template %q: %v", name, err)
+		th.renderError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	ww := countWriter{w: w}
-	if err := t.Execute(&ww, args); err != nil {
+	bw := &bufferedWriter{w: w, threshold: th.streamingThreshold, flushInterval: th.flushInterval, lastFlush: time.Now()}
+	t = t.Funcs(template.FuncMap{
+		"flush":   func() string { bw.Flush(); return "" },
+		"context": func() context.Context { return r.Context() },
+	})
+
+	if err := t.Execute(bw, args); err != nil {
 		log.Printf("Executing template %q: %v", name, err)
-		if ww.N == 0 {
-			http.Error(w, "Error rendering template.", http.StatusInternalServerError)
+		if !bw.streaming {
+			th.renderError(w, r, http.StatusInternalServerError, err)
 			return
 		}
+		// Already streamed part of the response with a 200 status, so there
+		// is nothing left to do but give up; the client sees a truncated page.
+		return
+	}
+	bw.finish()
+}
+
+// bufferedWriter buffers template output in memory so that a failed
+// t.Execute never reaches the client as a truncated, broken 200 response:
+// Content-Type is only set, and the body only written, once rendering has
+// fully succeeded. The writer never sets Content-Length itself (see finish).
+//
+// If threshold is positive and the buffered output grows past it, or if
+// flushInterval has elapsed since the last flush, the writer instead
+// switches to (or continues) streaming directly to w, at the cost of
+// losing Content-Length and atomicity for that response. Flush forces this
+// immediately, for use by the {{flush}} template function.
+type bufferedWriter struct {
+	w             http.ResponseWriter
+	buf           bytes.Buffer
+	threshold     int
+	flushInterval time.Duration
+	streaming     bool
+	lastFlush     time.Time
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	if bw.streaming {
+		n, err := bw.w.Write(p)
+		if bw.flushInterval > 0 && time.Since(bw.lastFlush) >= bw.flushInterval {
+			bw.flushNow()
+		}
+		return n, err
+	}
+	if bw.threshold > 0 && bw.buf.Len()+len(p) > bw.threshold {
+		bw.startStreaming()
+		return bw.w.Write(p)
 	}
+	if bw.flushInterval > 0 && time.Since(bw.lastFlush) >= bw.flushInterval {
+		// WithFlushInterval on its own (no threshold, no {{flush}} call yet)
+		// must still be able to switch into streaming mode, or the interval
+		// never has any effect until something else triggers it.
+		bw.startStreaming()
+		n, err := bw.w.Write(p)
+		bw.flushNow()
+		return n, err
+	}
+	return bw.buf.Write(p)
+}
+
+// Flush forces any buffered output to be sent to the client immediately,
+// switching the writer into streaming mode for the rest of the response.
+// It is installed as the {{flush}} template function.
+func (bw *bufferedWriter) Flush() {
+	if !bw.streaming {
+		bw.startStreaming()
+	}
+	bw.flushNow()
+}
+
+func (bw *bufferedWriter) startStreaming() {
+	bw.w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	bw.w.Write(bw.buf.Bytes())
+	bw.buf.Reset()
+	bw.streaming = true
 }
 
-// a countwriter wraps any other writer and tracks how many bytes are written to it.
-type countWriter struct {
-	w io.Writer
-	N int
+func (bw *bufferedWriter) flushNow() {
+	if f, ok := bw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	bw.lastFlush = time.Now()
 }
 
-func (w *countWriter) Write(b []byte) (int, error) {
-	n, err := w.w.Write(b)
-	w.N += n
-	return n, err
+// finish is called once rendering has completed without error; if the
+// response was buffered in full it sets the final headers and writes the
+// body, otherwise (streaming mode) the body has already been written.
+//
+// Content-Length is deliberately left for net/http to work out on its own
+// (it sets it when the whole body fits in its own output buffer, and sends
+// larger bodies chunked): bw.buf holds the pre-transform bytes, but outer middleware
+// such as Gzip can still rewrite what actually goes out on the wire, and a
+// Content-Length computed from the wrong size turns every response into a
+// broken one (the client sees an unexpected EOF well short of what the
+// header promised).
+func (bw *bufferedWriter) finish() {
+	if bw.streaming {
+		return
+	}
+	bw.w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	bw.w.Write(bw.buf.Bytes())
 }
@@ -0,0 +1,128 @@
+package tmpl
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBufferedWriterBuffersUnderThreshold(t *testing.T) {
+	rec := httptest.NewRecorder()
+	bw := &bufferedWriter{w: rec, threshold: 100}
+
+	if _, err := bw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if bw.streaming {
+		t.Fatal("expected bufferedWriter to still be buffering under threshold")
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("expected nothing written to the underlying writer yet, got %q", rec.Body.String())
+	}
+
+	bw.finish()
+	if got, want := rec.Body.String(), "hello"; got != want {
+		t.Fatalf("finish: body = %q, want %q", got, want)
+	}
+	// finish must not hand-compute Content-Length from the pre-transform
+	// buffer: outer middleware (e.g. Gzip) can still change how many bytes
+	// actually go out on the wire, and a wrong Content-Length breaks the
+	// response. Leave it to net/http to work out instead.
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Fatalf("Content-Length = %q, want unset so net/http can determine it itself", got)
+	}
+}
+
+func TestBufferedWriterStreamsOverThreshold(t *testing.T) {
+	rec := httptest.NewRecorder()
+	bw := &bufferedWriter{w: rec, threshold: 4}
+
+	if _, err := bw.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if !bw.streaming {
+		t.Fatal("expected bufferedWriter to switch to streaming once past threshold")
+	}
+	if got, want := rec.Body.String(), "hello"; got != want {
+		t.Fatalf("body = %q, want %q (should be written immediately once streaming)", got, want)
+	}
+
+	// Further writes go straight through.
+	if _, err := bw.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.Body.String(), "hello world"; got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+
+	// finish is a no-op once streaming: Content-Length must not be set
+	// retroactively for a response that's already partially on the wire.
+	bw.finish()
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Fatalf("Content-Length = %q, want unset once streaming", got)
+	}
+}
+
+func TestBufferedWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	bw := &bufferedWriter{w: rec, threshold: 1000}
+
+	if _, err := bw.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatal("expected nothing written before Flush")
+	}
+
+	bw.Flush()
+	if !bw.streaming {
+		t.Fatal("Flush should switch the writer into streaming mode")
+	}
+	if got, want := rec.Body.String(), "partial"; got != want {
+		t.Fatalf("body after Flush = %q, want %q", got, want)
+	}
+	if !rec.Flushed {
+		t.Fatal("expected Flush to call the underlying ResponseWriter's Flush")
+	}
+}
+
+func TestBufferedWriterFlushIntervalAutoFlushes(t *testing.T) {
+	rec := httptest.NewRecorder()
+	// Force streaming via the threshold, then confirm a write past
+	// flushInterval triggers a flush of the underlying writer too.
+	bw := &bufferedWriter{w: rec, threshold: 1}
+	bw.Write([]byte("xx"))
+	if !bw.streaming {
+		t.Fatal("expected threshold to push the writer into streaming")
+	}
+
+	bw.flushInterval = 1 // any nonzero Since(lastFlush) counts as elapsed
+	rec.Flushed = false
+	bw.Write([]byte("y"))
+	if !rec.Flushed {
+		t.Fatal("expected a write past flushInterval to flush the underlying writer")
+	}
+}
+
+// TestBufferedWriterFlushIntervalAloneSwitchesToStreaming is the regression
+// test for WithFlushInterval being a no-op when used on its own (no
+// WithStreamingThreshold, no {{flush}} call): the periodic-flush check used
+// to only run once already streaming, so nothing ever made the writer start
+// streaming in the first place.
+func TestBufferedWriterFlushIntervalAloneSwitchesToStreaming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	bw := &bufferedWriter{w: rec, flushInterval: 1, lastFlush: time.Now().Add(-time.Hour)}
+
+	if _, err := bw.Write([]byte("row1")); err != nil {
+		t.Fatal(err)
+	}
+	if !bw.streaming {
+		t.Fatal("expected an elapsed flushInterval to switch the writer into streaming even with no threshold set")
+	}
+	if got, want := rec.Body.String(), "row1"; got != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+	if !rec.Flushed {
+		t.Fatal("expected the switch to also flush the underlying writer, not just write to it")
+	}
+}
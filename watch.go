@@ -0,0 +1,170 @@
+package tmpl
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the watcher waits after the last relevant
+// filesystem event before recompiling, so that an editor's multi-step save
+// (write temp file, rename over original, touch directory, ...) results in
+// a single recompile instead of one per event.
+const watchDebounce = 100 * time.Millisecond
+
+// WatchedHandler is like the handler returned by NewHandler, except it
+// recompiles its templates in response to filesystem change notifications
+// instead of stat-ing the glob on every request.
+type WatchedHandler struct {
+	*handler
+
+	watcher   *fsnotify.Watcher
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWatchedHandler is like NewHandler, but instead of calling lastModified
+// (a filepath.Glob plus an os.Stat of every matching file) on every request,
+// it uses fsnotify to watch the directories containing files matched by
+// glob and only recompiles when a Write, Create or Rename event arrives for
+// a matching file. Bursts of events within watchDebounce of each other are
+// coalesced into a single recompile.
+//
+// If fsnotify.NewWatcher fails, for example because the process is running
+// in a container without inotify, NewWatchedHandler logs the error and
+// falls back to the stat-on-every-request behaviour of NewHandler.
+//
+// Call Close to stop the watcher goroutine.
+func NewWatchedHandler(glob string, ag ArgGetter, fm template.FuncMap, opts ...Option) *WatchedHandler {
+	if ag == nil {
+		ag = GetArgs
+	}
+	th := &handler{
+		pattern: glob,
+		getArgs: ag,
+		fm:      fm,
+	}
+	for _, opt := range opts {
+		opt(th)
+	}
+	th.recompileIfOlderThan(time.Time{})
+
+	wh := &WatchedHandler{handler: th}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("tmpl: fsnotify unavailable (%v), falling back to stat-on-request", err)
+		return wh
+	}
+
+	for _, dir := range watchDirs(glob) {
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("tmpl: watching %q: %v", dir, err)
+		}
+	}
+
+	wh.watcher = watcher
+	wh.done = make(chan struct{})
+	go wh.watch()
+	return wh
+}
+
+// watchDirs returns the distinct directories that glob's matches live in,
+// plus glob's own directory so that files created after startup (and so not
+// yet matched) are still noticed.
+func watchDirs(glob string) []string {
+	dirs := map[string]bool{filepath.Dir(glob): true}
+	if matches, err := filepath.Glob(glob); err == nil {
+		for _, m := range matches {
+			dirs[filepath.Dir(m)] = true
+		}
+	}
+	r := make([]string, 0, len(dirs))
+	for d := range dirs {
+		r = append(r, d)
+	}
+	return r
+}
+
+// relevant reports whether event is a Write, Create or Rename of a file
+// whose base name matches the base name of the handler's glob pattern; the
+// directory part is not compared.
+func relevant(event fsnotify.Event, pattern string) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+		return false
+	}
+	ok, err := filepath.Match(filepath.Base(pattern), filepath.Base(event.Name))
+	return err == nil && ok
+}
+
+func (wh *WatchedHandler) watch() {
+	defer wh.watcher.Close()
+
+	timer := time.NewTimer(watchDebounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	pending := false
+
+	for {
+		select {
+		case event, ok := <-wh.watcher.Events:
+			if !ok {
+				return
+			}
+			if !relevant(event, wh.pattern) {
+				continue
+			}
+			pending = true
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(watchDebounce)
+
+		case <-timer.C:
+			if pending {
+				wh.recompileIfOlderThan(time.Now())
+				pending = false
+			}
+
+		case err, ok := <-wh.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("tmpl: watcher error: %v", err)
+
+		case <-wh.done:
+			return
+		}
+	}
+}
+
+// ServeHTTP serves the request. If the filesystem watcher is running,
+// recompilation is driven entirely by watch and ServeHTTP never touches the
+// filesystem; otherwise it falls back to the plain handler's
+// stat-on-every-request behaviour.
+func (wh *WatchedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if wh.watcher == nil {
+		wh.handler.ServeHTTP(w, r)
+		return
+	}
+	wh.serve(w, r)
+}
+
+// Close shuts down the watcher goroutine. It is safe to call more than once,
+// and is a no-op if the watcher could not be started in the first place.
+func (wh *WatchedHandler) Close() error {
+	if wh.watcher == nil {
+		return nil
+	}
+	wh.closeOnce.Do(func() { close(wh.done) })
+	return nil
+}
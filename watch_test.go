@@ -0,0 +1,109 @@
+package tmpl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestRelevant(t *testing.T) {
+	cases := []struct {
+		name    string
+		op      fsnotify.Op
+		evtName string
+		pattern string
+		want    bool
+	}{
+		{"write matches", fsnotify.Write, "/tmp/foo.html", "/tmp/*.html", true},
+		{"create matches", fsnotify.Create, "/tmp/foo.html", "/tmp/*.html", true},
+		{"rename matches", fsnotify.Rename, "/tmp/foo.html", "/tmp/*.html", true},
+		{"chmod ignored", fsnotify.Chmod, "/tmp/foo.html", "/tmp/*.html", false},
+		{"remove ignored", fsnotify.Remove, "/tmp/foo.html", "/tmp/*.html", false},
+		{"non-matching extension", fsnotify.Write, "/tmp/foo.txt", "/tmp/*.html", false},
+		{"different directory, same base name still matches (pattern is base-only)", fsnotify.Write, "/other/foo.html", "/tmp/*.html", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := relevant(fsnotify.Event{Name: c.evtName, Op: c.op}, c.pattern)
+			if got != c.want {
+				t.Errorf("relevant(%v, %q) = %v, want %v", c.op, c.pattern, got, c.want)
+			}
+		})
+	}
+}
+
+func TestWatchDirs(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "a.html"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := watchDirs(filepath.Join(sub, "*.html"))
+	if len(dirs) != 1 || dirs[0] != sub {
+		t.Fatalf("watchDirs = %v, want [%v]", dirs, sub)
+	}
+}
+
+// TestWatchDebounce exercises the debounce state machine in watch() end to
+// end: after several rapid writes within watchDebounce of each other, a
+// recompile must follow and leave foo.html parsed without error. It does not
+// count recompiles or check which write's content was picked up.
+func TestWatchDebounce(t *testing.T) {
+	dir := t.TempDir()
+	glob := filepath.Join(dir, "*.html")
+	tmplFile := filepath.Join(dir, "foo.html")
+
+	write := func(content string) {
+		if err := os.WriteFile(tmplFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{{define "foo.html"}}v1{{end}}`)
+
+	wh := NewWatchedHandler(glob, nil, nil)
+	defer wh.Close()
+	if wh.watcher == nil {
+		t.Skip("fsnotify unavailable in this environment")
+	}
+
+	firstParsed := wh.handler.lastParsed
+
+	// Several rapid writes within the debounce window should collapse into
+	// one recompile reflecting the last write, not a recompile per write.
+	for i := 0; i < 5; i++ {
+		write(`{{define "foo.html"}}v2{{end}}`)
+		time.Sleep(watchDebounce / 4)
+	}
+	write(`{{define "foo.html"}}v3{{end}}`)
+
+	// Give the debounce timer time to fire after the last event.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		wh.handler.Lock()
+		parsed := wh.handler.lastParsed
+		wh.handler.Unlock()
+		if parsed.After(firstParsed) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	wh.handler.Lock()
+	tmpl := wh.handler.tmpl
+	err := wh.handler.err
+	wh.handler.Unlock()
+	if err != nil {
+		t.Fatalf("recompile error: %v", err)
+	}
+	if tmpl == nil || tmpl.Lookup("foo.html") == nil {
+		t.Fatal("expected foo.html to be parsed after debounced recompile")
+	}
+}